@@ -2,31 +2,99 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
+
+	"urlgrabber/pkg/consumer"
+	"urlgrabber/pkg/download"
+	"urlgrabber/pkg/pget"
+	"urlgrabber/pkg/retry"
+	"urlgrabber/pkg/scan"
 )
 
-const maxMemoryFileSize = 1024 * 1024 * 1024 // 1 GB
+// defaultMaxTokenSize bounds how large a single token (and therefore
+// scanner.Buffer) may grow; it replaces the old whole-file in-memory
+// read path.
+const defaultMaxTokenSize = 1024 * 1024 // 1 MB
 
-var timeout time.Duration
+var (
+	timeout            time.Duration
+	delimiters         string
+	regexPattern       string
+	maxTokenSize       int
+	manifestPath       string
+	maxConcurrentFiles int64
+	maxRetries         int
+)
 
 func init() {
 	flag.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout duration for HTTP requests")
 	flag.DurationVar(&timeout, "t", 10*time.Second, "Shorthand for --timeout")
+	registerScanFlags(flag.CommandLine)
+	registerManifestFlags(flag.CommandLine)
+	registerRetryFlags(flag.CommandLine)
+}
+
+// registerScanFlags registers the tokenizer flags shared by the default
+// mode and the download subcommand, so the two flag sets can't drift
+// out of sync with each other.
+func registerScanFlags(fs *flag.FlagSet) {
+	fs.StringVar(&delimiters, "delimiters", scan.DefaultDelimiters, "Characters that separate URLs in input files")
+	fs.StringVar(&regexPattern, "regex", "", "Regular expression to split URLs on, instead of --delimiters")
+	fs.IntVar(&maxTokenSize, "max-token-size", defaultMaxTokenSize, "Maximum size in bytes of a single scanned token")
+}
+
+// registerManifestFlags registers the --manifest mode flags shared by
+// the default mode and the download subcommand, so the two flag sets
+// can't drift out of sync with each other.
+func registerManifestFlags(fs *flag.FlagSet) {
+	fs.StringVar(&manifestPath, "manifest", "", "JSON or YAML manifest of {url, dest, sha256, headers} entries to fetch, instead of scanning files for URLs")
+	fs.Int64Var(&maxConcurrentFiles, "max-concurrent-files", pget.DefaultMaxConcurrentFiles, "Maximum number of manifest entries fetched at once")
+}
+
+// registerRetryFlags registers the retry-middleware flags shared by the
+// default mode and the download subcommand, so the two flag sets can't
+// drift out of sync with each other.
+func registerRetryFlags(fs *flag.FlagSet) {
+	fs.IntVar(&maxRetries, "max-retries", retry.DefaultMaxRetries, "Maximum number of retries for a request that fails with a network error, 5xx, or 429")
+}
+
+// newClient builds the retrying HTTP client shared by every fetch path,
+// so network errors, 5xx responses, and 429s are all retried with
+// exponential backoff rather than failing on the first attempt.
+func newClient() *retry.Client {
+	return retry.New(&http.Client{Timeout: timeout}, maxRetries)
+}
+
+// buildSplitFunc returns the bufio.SplitFunc described by the current
+// --delimiters/--regex flags.
+func buildSplitFunc() (bufio.SplitFunc, error) {
+	if regexPattern != "" {
+		re, err := regexp.Compile(regexPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --regex: %w", err)
+		}
+		return scan.SplitRegex(re), nil
+	}
+	return scan.Split(delimiters), nil
 }
 
 func isValidURL(url string) bool {
-	client := &http.Client{
-		Timeout: timeout,
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return false
 	}
 
-	resp, err := client.Head(url)
+	resp, err := newClient().Do(req)
 	if err != nil {
 		return false
 	}
@@ -44,7 +112,10 @@ func isValidURL(url string) bool {
 	return statusCode >= 200 && statusCode < 400
 }
 
-func extractURLs(filePath string, wg *sync.WaitGroup, urlChan chan<- string, workerPool chan struct{}) {
+// extractURLs scans filePath token by token using split, so a file of
+// any size is processed in O(maxTokenSize) memory rather than being
+// read into RAM whole.
+func extractURLs(filePath string, wg *sync.WaitGroup, urlChan chan<- string, workerPool chan struct{}, split bufio.SplitFunc, maxTokenSize int) {
 	defer wg.Done()
 
 	file, err := os.Open(filePath)
@@ -54,61 +125,49 @@ func extractURLs(filePath string, wg *sync.WaitGroup, urlChan chan<- string, wor
 	}
 	defer file.Close()
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		fmt.Printf("Error getting file info for %s: %v\n", filePath, err)
-		return
-	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTokenSize)
+	scanner.Split(split)
 
-	if fileInfo.Size() < int64(maxMemoryFileSize) {
+	for scanner.Scan() {
 		workerPool <- struct{}{}
-		// Cache the file in memory if it's small enough
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", filePath, err)
-			return
-		}
-
-		// Process the cached content
-		for _, line := range strings.Split(string(content), ",") {
-			line = strings.TrimSpace(line)
-			if isValidURL(line) {
-				urlChan <- line
-			}
+		token := strings.TrimSpace(scanner.Text())
+		if token != "" && isValidURL(token) {
+			urlChan <- token
 		}
 		<-workerPool
-	} else {
-		// Process the file line by line for large files
-		scanner := bufio.NewScanner(file)
-
-		for scanner.Scan() {
-			workerPool <- struct{}{}
-			line := scanner.Text()
-			for _, part := range strings.Split(line, ",") {
-				part = strings.TrimSpace(part)
-				if isValidURL(part) {
-					urlChan <- part
-				}
-			}
-			<-workerPool
-		}
+	}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Printf("Error reading file %s: %v\n", filePath, err)
-			return
-		}
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Error reading file %s: %v\n", filePath, err)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "download" {
+		runDownload(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
+	if manifestPath != "" {
+		runManifest(manifestPath)
+		return
+	}
+
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: go run main.go [--timeout DURATION | -t DURATION] <file1> <file2> ...")
 		flag.PrintDefaults()
 		return
 	}
 
+	split, err := buildSplitFunc()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
 	urlChan := make(chan string)
 	workerPool := make(chan struct{}, 100) // Adjust the number of concurrent workers as needed
 	var wg sync.WaitGroup
@@ -121,7 +180,7 @@ func main() {
 
 			if !info.IsDir() {
 				wg.Add(1)
-				go extractURLs(path, &wg, urlChan, workerPool)
+				go extractURLs(path, &wg, urlChan, workerPool, split, maxTokenSize)
 			}
 
 			return nil
@@ -141,3 +200,148 @@ func main() {
 		fmt.Println(url)
 	}
 }
+
+// runManifest implements --manifest mode: it loads a JSON or YAML list
+// of {url, dest, sha256, headers} entries and fetches each one,
+// verifying its checksum when one is given, independently of the
+// file-scanning pipeline used for loose URL lists.
+func runManifest(path string) {
+	m, err := pget.LoadManifest(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading manifest %s: %v\n", path, err)
+		return
+	}
+
+	runner := pget.NewRunner(newClient(), maxConcurrentFiles)
+	errs := runner.Run(context.Background(), m)
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching %s -> %s: %v\n", m[i].URL, m[i].Dest, err)
+		}
+	}
+}
+
+// runDownload implements the "download" subcommand: it validates URLs
+// extracted from the given files exactly like the default mode, then
+// fetches each one to disk with a parallel, chunked Downloader. When
+// --extract, --output/-o or --null is given, each URL is instead fetched
+// with a single streaming GET and handed to the selected consumer, and
+// --manifest switches to manifest mode.
+func runDownload(args []string) {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	fs.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout duration for HTTP requests")
+	fs.DurationVar(&timeout, "t", 10*time.Second, "Shorthand for --timeout")
+	workers := fs.Int("workers", runtime.NumCPU()*4, "Number of concurrent range-request chunks per file")
+	outputDir := fs.String("output-dir", ".", "Directory to write downloaded files into")
+	extractDir := fs.String("extract", "", "Extract each URL's body as a tar archive under this directory, instead of writing a plain file")
+	output := fs.String("output", "", `Write every URL's body to this path ("-" for stdout), instead of one file per URL`)
+	fs.StringVar(output, "o", "", "Shorthand for --output")
+	null := fs.Bool("null", false, "Discard downloaded bytes instead of writing them anywhere, for throughput testing")
+	registerScanFlags(fs)
+	registerManifestFlags(fs)
+	registerRetryFlags(fs)
+	fs.Parse(args)
+
+	if manifestPath != "" {
+		runManifest(manifestPath)
+		return
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Println("Usage: urlgrabber download [--timeout DURATION] [--workers N] [--output-dir DIR] <file1> <file2> ...")
+		fs.PrintDefaults()
+		return
+	}
+
+	split, err := buildSplitFunc()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	urlChan := make(chan string)
+	workerPool := make(chan struct{}, 100)
+	var wg sync.WaitGroup
+
+	for _, filePath := range fs.Args() {
+		err := filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() {
+				wg.Add(1)
+				go extractURLs(path, &wg, urlChan, workerPool, split, maxTokenSize)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			fmt.Printf("Error walking path %s: %v\n", filePath, err)
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		close(urlChan)
+	}()
+
+	ctx := context.Background()
+
+	if c := buildConsumer(*extractDir, *output, *null); c != nil {
+		client := newClient()
+		for url := range urlChan {
+			if err := fetchAndConsume(ctx, client, url, c); err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching %s: %v\n", url, err)
+			}
+		}
+		return
+	}
+
+	dl := download.New(newClient(), *workers)
+
+	for url := range urlChan {
+		dest := filepath.Join(*outputDir, filepath.Base(url))
+		fmt.Printf("Downloading %s -> %s\n", url, dest)
+		if err := dl.Download(ctx, url, dest); err != nil {
+			fmt.Fprintf(os.Stderr, "Error downloading %s: %v\n", url, err)
+		}
+	}
+}
+
+// buildConsumer selects a consumer.Consumer from the download
+// subcommand's output flags, or nil if none was given and the caller
+// should use the default chunked Downloader instead.
+func buildConsumer(extractDir, output string, null bool) consumer.Consumer {
+	switch {
+	case null:
+		return consumer.NullConsumer{}
+	case extractDir != "":
+		return consumer.TarExtractConsumer{Dir: extractDir}
+	case output == "-":
+		return consumer.StdoutConsumer{}
+	case output != "":
+		return &consumer.FileConsumer{Path: output}
+	default:
+		return nil
+	}
+}
+
+// fetchAndConsume issues a single streaming GET for url and hands its
+// body to c, bypassing the chunked Downloader since consumers like
+// TarExtractConsumer need to process bytes in order as they arrive.
+func fetchAndConsume(ctx context.Context, client *retry.Client, url string, c consumer.Consumer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return c.Consume(ctx, url, resp.Body, resp.ContentLength)
+}
@@ -0,0 +1,130 @@
+// Package consumer decouples fetching a URL's body from what happens to
+// its bytes: a Consumer only needs an io.Reader, so the same fetch
+// pipeline can write a single file, extract a tarball, discard the
+// bytes for throughput probing, or concatenate everything to stdout.
+package consumer
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Consumer receives the body of a fetched URL.
+type Consumer interface {
+	// Consume reads r to completion and does something with the bytes
+	// fetched from url. size is the advertised Content-Length, or -1 if
+	// unknown.
+	Consume(ctx context.Context, url string, r io.Reader, size int64) error
+}
+
+// FileConsumer writes every URL's body to a single file at Path,
+// mirroring StdoutConsumer but to disk: the first Consume call
+// truncates Path, and subsequent calls append, so multiple URLs
+// concatenate into one destination.
+type FileConsumer struct {
+	Path string
+
+	mu     sync.Mutex
+	opened bool
+}
+
+// Consume implements Consumer.
+func (c *FileConsumer) Consume(_ context.Context, _ string, r io.Reader, _ int64) error {
+	c.mu.Lock()
+	flags := os.O_CREATE | os.O_WRONLY
+	if c.opened {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	c.opened = true
+	c.mu.Unlock()
+
+	file, err := os.OpenFile(c.Path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, r)
+	return err
+}
+
+// TarExtractConsumer streams r as a tar archive and writes each entry
+// under Dir, rejecting entries whose path would escape Dir.
+type TarExtractConsumer struct {
+	Dir string
+}
+
+// Consume implements Consumer.
+func (c TarExtractConsumer) Consume(_ context.Context, url string, r io.Reader, _ int64) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", url, err)
+		}
+
+		target := filepath.Join(c.Dir, hdr.Name)
+		rel, err := filepath.Rel(c.Dir, target)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("extracting %s: tar entry %q escapes %s", url, hdr.Name, c.Dir)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeTarFile(target, hdr, tr); err != nil {
+				return err
+			}
+		default:
+			// Symlinks, devices, and other entry types are skipped
+			// rather than materialized.
+		}
+	}
+}
+
+func writeTarFile(target string, hdr *tar.Header, r io.Reader) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, r)
+	return err
+}
+
+// NullConsumer discards the body, useful for benchmarking fetch
+// throughput without disk I/O.
+type NullConsumer struct{}
+
+// Consume implements Consumer.
+func (NullConsumer) Consume(_ context.Context, _ string, r io.Reader, _ int64) error {
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+// StdoutConsumer concatenates every URL's body to os.Stdout.
+type StdoutConsumer struct{}
+
+// Consume implements Consumer.
+func (StdoutConsumer) Consume(_ context.Context, _ string, r io.Reader, _ int64) error {
+	_, err := io.Copy(os.Stdout, r)
+	return err
+}
@@ -0,0 +1,65 @@
+package download
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// stateSuffix names the sidecar resume-state file written next to a
+// download's destination while it is in progress.
+const stateSuffix = ".pget-state"
+
+// chunkState records a chunk's byte range and whether it has already
+// been fetched, so a restart can skip completed chunks.
+type chunkState struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  bool  `json:"done"`
+}
+
+// resumeState is the sidecar JSON persisted next to a destination file
+// while a chunked download is in progress.
+type resumeState struct {
+	URL          string       `json:"url"`
+	ETag         string       `json:"etag,omitempty"`
+	LastModified string       `json:"last_modified,omitempty"`
+	Chunks       []chunkState `json:"chunks"`
+}
+
+// matchesValidator reports whether etag/lastModified, as observed on a
+// fresh probe, still identify the same representation this state was
+// recorded for.
+func (s *resumeState) matchesValidator(etag, lastModified string) bool {
+	if etag != "" || s.ETag != "" {
+		return etag == s.ETag
+	}
+	return lastModified == s.LastModified
+}
+
+func statePath(dest string) string {
+	return dest + stateSuffix
+}
+
+func loadState(dest string) (*resumeState, error) {
+	data, err := os.ReadFile(statePath(dest))
+	if err != nil {
+		return nil, err
+	}
+	var s resumeState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *resumeState) save(dest string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(dest), data, 0o644)
+}
+
+func removeState(dest string) {
+	os.Remove(statePath(dest))
+}
@@ -0,0 +1,65 @@
+// Package pget implements a structured manifest mode for urlgrabber: a
+// JSON or YAML list of {url, dest, sha256, headers} entries that are
+// fetched and checksum-verified, as an alternative to scanning loose
+// text files for URLs.
+package pget
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Entry describes a single file to fetch: where to get it, where to
+// write it, and (optionally) the SHA-256 digest it must match and any
+// extra request headers to send.
+type Entry struct {
+	URL     string            `json:"url" yaml:"url"`
+	Dest    string            `json:"dest" yaml:"dest"`
+	SHA256  string            `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// Manifest is an ordered list of entries to fetch.
+type Manifest []Entry
+
+// LoadManifest reads and parses a manifest file, choosing JSON or YAML
+// based on its extension (".yaml"/".yml" for YAML, JSON otherwise).
+func LoadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return ParseManifest(data, "yaml")
+	default:
+		return ParseManifest(data, "json")
+	}
+}
+
+// ParseManifest parses data as a manifest in the given format ("json"
+// or "yaml").
+func ParseManifest(data []byte, format string) (Manifest, error) {
+	var m Manifest
+
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("pget: parsing JSON manifest: %w", err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("pget: parsing YAML manifest: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("pget: unsupported manifest format %q", format)
+	}
+
+	return m, nil
+}
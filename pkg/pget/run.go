@@ -0,0 +1,124 @@
+package pget
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// DefaultMaxConcurrentFiles caps how many manifest entries are fetched
+// at once, independent of any per-file chunk concurrency a fetcher
+// might use internally.
+const DefaultMaxConcurrentFiles = 20
+
+// Doer is the subset of *http.Client that Runner depends on, so callers
+// can plug in a client that adds retry behavior.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Runner dispatches manifest entries, bounding how many run
+// concurrently with a weighted semaphore so a huge manifest doesn't
+// spawn thousands of goroutines at once.
+type Runner struct {
+	Client             Doer
+	MaxConcurrentFiles int64
+}
+
+// NewRunner returns a Runner that fetches with client, running at most
+// maxConcurrentFiles entries at a time.
+func NewRunner(client Doer, maxConcurrentFiles int64) *Runner {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if maxConcurrentFiles <= 0 {
+		maxConcurrentFiles = DefaultMaxConcurrentFiles
+	}
+	return &Runner{Client: client, MaxConcurrentFiles: maxConcurrentFiles}
+}
+
+// Run fetches every entry in m, verifying its checksum when one is
+// given. It returns one error per entry, in the same order as m, with
+// a nil entry for a successful fetch; entries are indexed rather than
+// keyed by URL so two entries that share a URL (e.g. mirrors with
+// different dests) each keep their own result.
+func (r *Runner) Run(ctx context.Context, m Manifest) []error {
+	sem := semaphore.NewWeighted(r.MaxConcurrentFiles)
+
+	errs := make([]error, len(m))
+	var wg sync.WaitGroup
+
+	for i, e := range m {
+		i, e := i, e
+		if err := sem.Acquire(ctx, 1); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			errs[i] = r.fetchEntry(ctx, e)
+		}()
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// fetchEntry downloads a single entry to e.Dest, computing its SHA-256
+// incrementally via an io.MultiWriter so the whole body never has to be
+// buffered just to verify the digest, and fails the entry if the
+// manifest's checksum doesn't match.
+func (r *Runner) fetchEntry(ctx context.Context, e Entry) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("fetching %s returned %s", e.URL, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.Dest), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(e.Dest)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hasher), resp.Body); err != nil {
+		os.Remove(e.Dest)
+		return err
+	}
+
+	if e.SHA256 != "" {
+		if sum := hex.EncodeToString(hasher.Sum(nil)); !strings.EqualFold(sum, e.SHA256) {
+			os.Remove(e.Dest)
+			return fmt.Errorf("checksum mismatch for %s: got %s, want %s", e.URL, sum, e.SHA256)
+		}
+	}
+	return nil
+}
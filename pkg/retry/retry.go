@@ -0,0 +1,115 @@
+// Package retry wraps an *http.Client so requests are retried with
+// exponential backoff and jitter on network errors, 5xx responses, and
+// 429s, honoring a Retry-After header when the origin sends one.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults for the exponential backoff schedule.
+const (
+	DefaultBaseDelay  = 500 * time.Millisecond
+	DefaultMaxDelay   = 30 * time.Second
+	DefaultMaxRetries = 5
+)
+
+// Client wraps an *http.Client, retrying failed requests with
+// exponential backoff and jitter.
+type Client struct {
+	Inner      *http.Client
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// New returns a Client that retries requests issued through inner up to
+// maxRetries times.
+func New(inner *http.Client, maxRetries int) *Client {
+	if inner == nil {
+		inner = http.DefaultClient
+	}
+	if maxRetries < 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	return &Client{
+		Inner:      inner,
+		MaxRetries: maxRetries,
+		BaseDelay:  DefaultBaseDelay,
+		MaxDelay:   DefaultMaxDelay,
+	}
+}
+
+// Do issues req, retrying on network errors, 5xx responses, and 429s up
+// to c.MaxRetries times. A Retry-After header on a retryable response
+// overrides the computed backoff delay.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.Inner.Do(req)
+
+		switch {
+		case err == nil && !retryable(resp.StatusCode):
+			return resp, nil
+		case attempt >= c.MaxRetries:
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		if err == nil {
+			if ra := retryAfter(resp); ra > 0 {
+				delay = ra
+			}
+			resp.Body.Close()
+		}
+
+		if werr := c.wait(req.Context(), delay); werr != nil {
+			return nil, werr
+		}
+	}
+}
+
+func retryable(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests
+}
+
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// backoff returns the delay before the (attempt+1)th retry: a base
+// delay doubled once per prior attempt, capped at MaxDelay, with up to
+// 50% jitter to avoid synchronized retries.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.BaseDelay << attempt
+	if d <= 0 || d > c.MaxDelay {
+		d = c.MaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/2 + 1))
+	return d/2 + jitter
+}
+
+// retryAfter parses a Retry-After header, which may be either a number
+// of seconds or an HTTP date. It returns 0 if the header is absent or
+// unparsable.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
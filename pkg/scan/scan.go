@@ -0,0 +1,85 @@
+// Package scan provides bufio.SplitFunc tokenizers for delimiter- and
+// regex-separated URL lists, so a reader can scan an arbitrarily large
+// file in O(maxTokenSize) memory instead of loading it whole.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// DefaultDelimiters mirrors the separators urlgrabber historically
+// accepted across its small- and large-file code paths: commas,
+// newlines, tabs, spaces, and carriage returns.
+const DefaultDelimiters = ",\n\t \r"
+
+// ScanURLs is the default SplitFunc used by urlgrabber, splitting on
+// DefaultDelimiters. Library users can plug it into their own
+// bufio.Scanner.
+var ScanURLs = Split(DefaultDelimiters)
+
+// Split returns a bufio.SplitFunc that splits on any byte in
+// delimiters, skipping empty tokens produced by runs of consecutive
+// delimiters.
+func Split(delimiters string) bufio.SplitFunc {
+	isDelim := func(b byte) bool {
+		return strings.IndexByte(delimiters, b) >= 0
+	}
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		start := 0
+		for ; start < len(data); start++ {
+			if !isDelim(data[start]) {
+				break
+			}
+		}
+
+		for i := start; i < len(data); i++ {
+			if isDelim(data[i]) {
+				return i + 1, data[start:i], nil
+			}
+		}
+
+		if atEOF {
+			if start == len(data) {
+				return len(data), nil, nil
+			}
+			return len(data), data[start:], nil
+		}
+
+		// Request more data before deciding whether data[start:] is a
+		// complete token.
+		return start, nil, nil
+	}
+}
+
+// SplitRegex returns a bufio.SplitFunc that splits data on substrings
+// matching re, for callers that need delimiters regexp.Split can
+// express but a fixed byte set cannot.
+func SplitRegex(re *regexp.Regexp) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		loc := re.FindReaderIndex(bytes.NewReader(data))
+		if loc == nil {
+			if atEOF {
+				if len(data) == 0 {
+					return 0, nil, nil
+				}
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		}
+
+		// A match touching the end of the buffer might extend further
+		// once more data arrives; wait for it unless we're at EOF.
+		if loc[1] == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+
+		if loc[0] == 0 {
+			return loc[1], nil, nil
+		}
+		return loc[1], data[:loc[0]], nil
+	}
+}